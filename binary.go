@@ -0,0 +1,313 @@
+package mph
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// On-disk format: a fixed 48-byte header followed by the Seeds, Values and
+// Fingerprints arrays (each length-prefixed, uint64 element count, and
+// zero-padded to an 8-byte boundary) and finally a length-prefixed
+// HasherName string. The arrays are stored as raw native-endian bytes, not
+// decoded element by element, so OpenFile can hand back slices that alias
+// the mapped file directly. The header's endian marker lets Query-side code
+// detect a table written on a different-endian host and refuse to load it.
+// The checksum covers the whole record (header, with the checksum field
+// itself zeroed, plus body) so a corrupt Mask, FPBits or Seed is caught
+// alongside a corrupt body instead of only surfacing later as an
+// out-of-range index. Fingerprints is empty (and FPBits 0) for tables built
+// without fingerprinting; HasherName is empty for tables built with
+// New/NewUint64.
+const (
+	magic         = "MPH1"
+	formatVersion = 3
+	headerSize    = 48
+	alignment     = 8
+
+	endianLittle = uint32(1)
+	endianBig    = uint32(2)
+)
+
+var nativeEndian = func() uint32 {
+	var x uint32 = 1
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return endianLittle
+	}
+	return endianBig
+}()
+
+var (
+	// ErrInvalidFormat is returned when decoded bytes aren't a valid Table.
+	ErrInvalidFormat = errors.New("mph: invalid table format")
+	// ErrChecksumFailed is returned when a decoded table fails its checksum.
+	ErrChecksumFailed = errors.New("mph: checksum mismatch")
+)
+
+// MarshalBinary encodes t using the layout documented on WriteTo.
+func (t *Table) MarshalBinary() ([]byte, error) {
+	var buf []byte
+	w := &sliceWriter{buf: &buf}
+	if _, err := t.WriteTo(w); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a table previously produced by MarshalBinary or
+// WriteTo. The decoded Seeds/Values are copies, independent of data.
+func (t *Table) UnmarshalBinary(data []byte) error {
+	decoded, err := newTableFromBytes(data, false)
+	if err != nil {
+		return err
+	}
+	*t = *decoded
+	return nil
+}
+
+// WriteTo writes t in the format described above.
+func (t *Table) WriteTo(w io.Writer) (int64, error) {
+	seedsBody := uint32SliceBytes(t.Seeds)
+	valuesBody := int32SliceBytes(t.Values)
+	fpBody := uint16SliceBytes(t.Fingerprints)
+	nameBody := []byte(t.HasherName)
+
+	body := make([]byte, 0, 8+len(seedsBody)+alignment+8+len(valuesBody)+alignment+8+len(fpBody)+alignment+8+len(nameBody)+alignment)
+	body = appendUint64(body, uint64(len(t.Seeds)))
+	body = append(body, seedsBody...)
+	body = append(body, padBytes(len(seedsBody))...)
+	body = appendUint64(body, uint64(len(t.Values)))
+	body = append(body, valuesBody...)
+	body = append(body, padBytes(len(valuesBody))...)
+	body = appendUint64(body, uint64(len(t.Fingerprints)))
+	body = append(body, fpBody...)
+	body = append(body, padBytes(len(fpBody))...)
+	body = appendUint64(body, uint64(len(nameBody)))
+	body = append(body, nameBody...)
+	body = append(body, padBytes(len(nameBody))...)
+
+	var hdr [headerSize]byte
+	copy(hdr[0:4], magic)
+	binary.LittleEndian.PutUint32(hdr[4:8], formatVersion)
+	binary.LittleEndian.PutUint64(hdr[8:16], uint64(len(t.Values)))
+	binary.LittleEndian.PutUint64(hdr[16:24], t.Mask)
+	binary.LittleEndian.PutUint32(hdr[24:28], nativeEndian)
+	// hdr[28:32] (checksum) is filled in below, once the rest of the header
+	// it covers is in place.
+	hdr[32] = t.FPBits
+	// hdr[33:40] reserved for future use, left zero.
+	binary.LittleEndian.PutUint64(hdr[40:48], t.Seed)
+	binary.LittleEndian.PutUint32(hdr[28:32], checksumRecord(hdr[:], body))
+
+	n1, err := w.Write(hdr[:])
+	if err != nil {
+		return int64(n1), err
+	}
+	n2, err := w.Write(body)
+	return int64(n1 + n2), err
+}
+
+// OpenFile mmaps the table stored at path and returns a Table backed
+// directly by the mapped bytes: Query runs against the file's pages with no
+// decode step. Call Close when done to unmap. On platforms without mmap
+// support the file is read into memory instead, and Close is a no-op.
+func OpenFile(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := mmapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := newTableFromBytes(raw, true)
+	if err != nil {
+		munmap(raw)
+		return nil, err
+	}
+	t.raw = raw
+	return t, nil
+}
+
+// Close unmaps the memory backing t if it was returned by OpenFile. It is a
+// no-op for tables built directly or decoded with UnmarshalBinary.
+func (t *Table) Close() error {
+	if t.raw == nil {
+		return nil
+	}
+	err := munmap(t.raw)
+	t.raw = nil
+	return err
+}
+
+func newTableFromBytes(data []byte, zeroCopy bool) (*Table, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: truncated header", ErrInvalidFormat)
+	}
+	if string(data[0:4]) != magic {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidFormat)
+	}
+	if v := binary.LittleEndian.Uint32(data[4:8]); v != formatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidFormat, v)
+	}
+	mask := binary.LittleEndian.Uint64(data[16:24])
+	endian := binary.LittleEndian.Uint32(data[24:28])
+	wantChecksum := binary.LittleEndian.Uint32(data[28:32])
+	fpBits := data[32]
+	seed := binary.LittleEndian.Uint64(data[40:48])
+
+	body := data[headerSize:]
+	var hdr [headerSize]byte
+	copy(hdr[:], data[:headerSize])
+	binary.LittleEndian.PutUint32(hdr[28:32], 0)
+	if checksumRecord(hdr[:], body) != wantChecksum {
+		return nil, ErrChecksumFailed
+	}
+	if endian != nativeEndian {
+		return nil, fmt.Errorf("%w: table was written on a different-endian host", ErrInvalidFormat)
+	}
+
+	off := 0
+	seedsLen := binary.LittleEndian.Uint64(body[off : off+8])
+	off += 8
+	seedsByteLen := int(seedsLen) * 4
+	seedsBytes := body[off : off+seedsByteLen]
+	off += seedsByteLen + len(padBytes(seedsByteLen))
+
+	valuesLen := binary.LittleEndian.Uint64(body[off : off+8])
+	off += 8
+	valuesByteLen := int(valuesLen) * 4
+	valuesBytes := body[off : off+valuesByteLen]
+	off += valuesByteLen + len(padBytes(valuesByteLen))
+
+	fpLen := binary.LittleEndian.Uint64(body[off : off+8])
+	off += 8
+	fpByteLen := int(fpLen) * 2
+	fpBytes := body[off : off+fpByteLen]
+	off += fpByteLen + len(padBytes(fpByteLen))
+
+	nameLen := binary.LittleEndian.Uint64(body[off : off+8])
+	off += 8
+	nameBytes := body[off : off+int(nameLen)]
+
+	var seeds []uint32
+	var values []int32
+	var fps []uint16
+	if zeroCopy {
+		seeds = bytesToUint32Slice(seedsBytes)
+		values = bytesToInt32Slice(valuesBytes)
+		fps = bytesToUint16Slice(fpBytes)
+	} else {
+		seeds = append([]uint32(nil), bytesToUint32Slice(seedsBytes)...)
+		values = append([]int32(nil), bytesToInt32Slice(valuesBytes)...)
+		fps = append([]uint16(nil), bytesToUint16Slice(fpBytes)...)
+	}
+
+	if len(seeds) != len(values) {
+		return nil, fmt.Errorf("%w: Seeds/Values length mismatch", ErrInvalidFormat)
+	}
+	if len(seeds) > 0 && mask+1 != uint64(len(seeds)) {
+		return nil, fmt.Errorf("%w: Mask inconsistent with table size", ErrInvalidFormat)
+	}
+	if fpBits > 0 && len(fps) != len(seeds) {
+		return nil, fmt.Errorf("%w: Fingerprints length inconsistent with FPBits", ErrInvalidFormat)
+	}
+
+	return &Table{
+		Seeds:        seeds,
+		Values:       values,
+		Mask:         mask,
+		Fingerprints: fps,
+		FPBits:       fpBits,
+		Seed:         seed,
+		HasherName:   string(nameBytes),
+	}, nil
+}
+
+// checksumRecord computes the crc32 covering a table's whole on-disk
+// record: hdr (with the checksum field itself already zeroed by the
+// caller) followed by body.
+func checksumRecord(hdr []byte, body []byte) uint32 {
+	c := crc32.NewIEEE()
+	c.Write(hdr)
+	c.Write(body)
+	return c.Sum32()
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var tmp [8]byte
+	binary.LittleEndian.PutUint64(tmp[:], v)
+	return append(b, tmp[:]...)
+}
+
+func padBytes(n int) []byte {
+	if rem := n % alignment; rem != 0 {
+		return make([]byte, alignment-rem)
+	}
+	return nil
+}
+
+func uint32SliceBytes(s []uint32) []byte {
+	if len(s) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&s[0])), len(s)*4)
+}
+
+func int32SliceBytes(s []int32) []byte {
+	if len(s) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&s[0])), len(s)*4)
+}
+
+func bytesToUint32Slice(b []byte) []uint32 {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), len(b)/4)
+}
+
+func bytesToInt32Slice(b []byte) []int32 {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*int32)(unsafe.Pointer(&b[0])), len(b)/4)
+}
+
+func uint16SliceBytes(s []uint16) []byte {
+	if len(s) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&s[0])), len(s)*2)
+}
+
+func bytesToUint16Slice(b []byte) []uint16 {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*uint16)(unsafe.Pointer(&b[0])), len(b)/2)
+}
+
+// sliceWriter is a minimal io.Writer over a *[]byte, used so MarshalBinary
+// doesn't need to pull in bytes.Buffer for a single append loop.
+type sliceWriter struct {
+	buf *[]byte
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	*w.buf = append(*w.buf, p...)
+	return len(p), nil
+}
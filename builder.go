@@ -0,0 +1,340 @@
+package mph
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Builder constructs a Table, optionally searching bucket seeds across
+// multiple goroutines. The zero Builder is a valid, sequential builder.
+type Builder struct {
+	// Workers is the number of goroutines used to search for bucket seeds
+	// concurrently. Values <= 1 build sequentially.
+	Workers int
+	// MaxSeed bounds how far a bucket's seed search may go before Build
+	// gives up with ErrCouldNotBuildTable. Zero means the default limit of
+	// 2^31, the largest value that fits alongside the singleton bit.
+	MaxSeed uint32
+	// Rand is reserved for seed-retry strategies built on top of Build (see
+	// the rebuild-with-a-different-seed support on BuilderOptions); Build
+	// itself doesn't consult it.
+	Rand *rand.Rand
+	// FingerprintBits, if non-zero, stores a fingerprint of that many bits
+	// per slot so Query can reject hashes that were never in the input set
+	// instead of returning an arbitrary index. Must be <= 16. Zero disables
+	// fingerprinting (the default), matching the original behavior.
+	FingerprintBits uint8
+}
+
+type entry struct {
+	idx  int32
+	hash uint64
+}
+
+// Build constructs a Table for keys. With Workers > 1, the seed search for
+// multi-key buckets is sharded across that many goroutines. Buckets are
+// always processed in the same stable order (size desc, then slot index
+// asc) and seeds within a bucket are tried in ascending order; workers may
+// search ahead concurrently, but each bucket only commits its slots once
+// every earlier-ordered bucket has committed, so the result is the same
+// regardless of Workers or goroutine scheduling.
+func (b Builder) Build(keys []uint64) (*Table, error) {
+	if len(keys) == 0 {
+		return &Table{}, nil
+	}
+
+	if len(keys) > (1 << 31) {
+		return nil, fmt.Errorf("%w: too many keys, 2^31 is the max", ErrCouldNotBuildTable)
+	}
+
+	if b.FingerprintBits > 16 {
+		return nil, fmt.Errorf("%w: fingerprint width must be <= 16 bits", ErrCouldNotBuildTable)
+	}
+
+	// early dedupe/error on duplicate hash
+	tmp := append([]uint64(nil), keys...)
+	sort.Slice(tmp, func(i, j int) bool { return tmp[i] < tmp[j] })
+	for i := 1; i < len(tmp); i++ {
+		if tmp[i] == tmp[i-1] {
+			return nil, fmt.Errorf("%w: duplicate 64-bit hash %d", ErrCouldNotBuildTable, tmp[i])
+		}
+	}
+
+	size := uint64(nextPower2(len(keys)))
+	mask := size - 1
+	h := make([][]entry, int(size))
+	values := make([]int32, int(size))
+	seeds := make([]uint32, int(size))
+
+	var fps []uint16
+	if b.FingerprintBits > 0 {
+		fps = make([]uint16, int(size))
+	}
+
+	for idx, k := range keys {
+		hash := k
+		// extract the lower log2 size bits
+		i := int(hash & mask)
+		// 0 means empty, that is why idx+1 is used
+		h[i] = append(h[i], entry{int32(idx) + 1, hash})
+	}
+
+	// pick the biggest buckets first - handle the most difficult before moving on to the simpler.
+	// SliceStable keeps ties in slot-index order so sharding the list across
+	// workers doesn't change which bucket claims which slot.
+	sort.SliceStable(h, func(i, j int) bool { return len(h[i]) > len(h[j]) })
+
+	var hidx int
+	for hidx = 0; hidx < len(h) && len(h[hidx]) > 1; hidx++ {
+	}
+
+	if err := b.sealBuckets(h[:hidx], values, seeds, fps, mask); err != nil {
+		return nil, err
+	}
+
+	// these are all singletons - entries with no conflicts in their respective buckets
+	// collect free values
+	free := make([]int, 0, int(size))
+	for i := range values {
+		if values[i] == 0 {
+			free = append(free, i)
+		} else {
+			// stored idx+1 before
+			values[i]--
+		}
+	}
+
+	for ; hidx < len(h) && len(h[int(hidx)]) > 0; hidx++ {
+		k := h[int(hidx)][0]
+		i := k.hash & mask
+
+		dst := free[0]
+		free = free[1:]
+
+		values[dst] = k.idx - 1
+		if fps != nil {
+			fps[dst] = fingerprint(k.hash, b.FingerprintBits)
+		}
+
+		// high bit = 1 (marked as singleton, no seed logic required to get to value), payload = dst.
+		seeds[int(i)] = singletonBit | uint32(dst)
+	}
+
+	return &Table{
+		Values:       values,
+		Seeds:        seeds,
+		Mask:         mask,
+		Fingerprints: fps,
+		FPBits:       b.FingerprintBits,
+	}, nil
+}
+
+// sealBuckets finds and commits a seed for every multi-key bucket in
+// buckets. With more than one worker it shards buckets round-robin so large
+// buckets (sorted to the front) spread across workers instead of piling
+// onto the first shard.
+func (b Builder) sealBuckets(buckets [][]entry, values []int32, seeds []uint32, fps []uint16, mask uint64) error {
+	workers := b.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	maxSeed := b.MaxSeed
+	if maxSeed == 0 || maxSeed > (1<<31) {
+		maxSeed = 1 << 31
+	}
+
+	if workers == 1 {
+		for _, subkeys := range buckets {
+			if err := sealBucket(subkeys, values, seeds, fps, b.FingerprintBits, mask, maxSeed, nil, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// ctx cancellation is how a bucket that exhausts maxSeed without ever
+	// taking its turn unblocks every other bucket waiting on the gate;
+	// without it, a failure past the first worker's turn would otherwise
+	// hang sealBuckets (and Build) forever. cancel is deferred so the
+	// watcher goroutine newCommitGate starts always exits, success or not.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gate := newCommitGate(ctx)
+
+	var firstErr error
+	var once sync.Once
+	var g errgroup.Group
+	for w := 0; w < workers; w++ {
+		w := w
+		g.Go(func() error {
+			for i := w; i < len(buckets); i += workers {
+				if err := sealBucket(buckets[i], values, seeds, fps, b.FingerprintBits, mask, maxSeed, gate, i); err != nil {
+					once.Do(func() { firstErr = err })
+					cancel()
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	return firstErr
+}
+
+// sealBucket searches seeds for subkeys until one displaces every key into a
+// slot that's free in values, then commits. Trial placements are kept in a
+// local scratch map so concurrent searches never interfere with each other,
+// and candidates are narrowed down to ones free of internal collisions
+// before gate is ever touched, so workers make progress on their own bucket
+// without contending on anything shared. When gate is non-nil, the bucket's
+// turn (its index among all multi-key buckets) must arrive before the first
+// commit attempt, so the slots a bucket sees as free are exactly the ones
+// every earlier-ordered bucket left behind - the same result a sequential
+// build would reach, regardless of which worker gets there first. Once a
+// bucket holds its turn it keeps it across retries (a failed commit just
+// means picking another internally-collision-free seed), since no other
+// bucket may commit out of turn anyway. A bucket that exhausts maxSeed
+// before ever taking its turn returns without calling gate.release, but
+// its caller cancels gate's context on any error, so every other bucket
+// blocked in gate.await unblocks instead of waiting on a turn that will
+// never come.
+func sealBucket(subkeys []entry, values []int32, seeds []uint32, fps []uint16, fpBits uint8, mask uint64, maxSeed uint32, gate *commitGate, turn int) error {
+	entries := make(map[uint64]entry, len(subkeys))
+
+	haveTurn := false
+	if gate != nil {
+		defer func() {
+			if haveTurn {
+				gate.release()
+			}
+		}()
+	}
+
+	var seed uint64
+	for {
+		if gate != nil && !haveTurn {
+			if err := gate.canceled(); err != nil {
+				return err
+			}
+		}
+
+		seed++
+		// we use the first bit for singletons
+		if seed >= uint64(maxSeed) {
+			return fmt.Errorf("%w: no seed < %d", ErrCouldNotBuildTable, maxSeed)
+		}
+
+		for k := range entries {
+			delete(entries, k)
+		}
+
+		collided := false
+		for _, k := range subkeys {
+			i := xorshiftMult64(k.hash+seed) & mask
+			if _, taken := entries[i]; taken {
+				collided = true
+				break
+			}
+			entries[i] = k
+		}
+		if collided {
+			continue
+		}
+
+		if gate != nil && !haveTurn {
+			if err := gate.await(turn); err != nil {
+				return err
+			}
+			haveTurn = true
+		}
+
+		if !commitBucket(entries, values, fps, fpBits) {
+			continue
+		}
+
+		// store this seed for the entire bucket
+		i := subkeys[0].hash & mask
+		seeds[int(i)] = uint32(seed) // fits in 31 bits
+		return nil
+	}
+}
+
+// commitBucket claims entries' slots in values if (and only if) all of them
+// are still free. The caller is responsible for ensuring no other bucket's
+// commit can race with this one (sealBuckets does this via commitGate).
+func commitBucket(entries map[uint64]entry, values []int32, fps []uint16, fpBits uint8) bool {
+	for i := range entries {
+		if values[int(i)] != 0 {
+			return false
+		}
+	}
+	for i, e := range entries {
+		values[int(i)] = e.idx
+		if fps != nil {
+			fps[int(i)] = fingerprint(e.hash, fpBits)
+		}
+	}
+	return true
+}
+
+// commitGate serializes bucket commits into the fixed bucket order (size
+// desc, then slot index asc) assigned by Build, independent of which
+// worker's search finishes first. await blocks until turn is next in line,
+// returning with the gate held for the caller's commit attempt; release
+// advances to the following turn and wakes whichever worker is waiting on
+// it. ctx cancellation wakes every waiter so one bucket failing outright
+// (never reaching its turn) can't leave the others blocked forever; a
+// background goroutine rebroadcasts on ctx.Done since sync.Cond itself
+// doesn't know about contexts.
+type commitGate struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	next int
+	ctx  context.Context
+}
+
+func newCommitGate(ctx context.Context) *commitGate {
+	g := &commitGate{ctx: ctx}
+	g.cond = sync.NewCond(&g.mu)
+	go func() {
+		<-ctx.Done()
+		g.mu.Lock()
+		g.cond.Broadcast()
+		g.mu.Unlock()
+	}()
+	return g
+}
+
+// canceled reports whether ctx has been canceled, without taking the turn.
+func (g *commitGate) canceled() error {
+	return g.ctx.Err()
+}
+
+// await blocks until turn is next in line, or returns ctx's error if it's
+// canceled first. On success the gate is left locked until release.
+func (g *commitGate) await(turn int) error {
+	g.mu.Lock()
+	for g.next != turn {
+		if err := g.ctx.Err(); err != nil {
+			g.mu.Unlock()
+			return err
+		}
+		g.cond.Wait()
+	}
+	if err := g.ctx.Err(); err != nil {
+		g.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (g *commitGate) release() {
+	g.next++
+	g.cond.Broadcast()
+	g.mu.Unlock()
+}
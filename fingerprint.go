@@ -0,0 +1,26 @@
+package mph
+
+import "math"
+
+// fingerprint extracts the top bits of hash, the bits not consumed by
+// hash & mask when picking a slot. Storing this alongside a slot lets Query
+// reject a hash that resolves to the slot by coincidence but was never in
+// the input set.
+func fingerprint(hash uint64, bits uint8) uint16 {
+	if bits == 0 {
+		return 0
+	}
+	return uint16(hash >> (64 - bits))
+}
+
+// FalsePositiveRate returns the probability that Query returns a hit for a
+// hash that was never in the input set, for a table built with the given
+// fingerprint width. It is 2^-bits; with bits == 0 (fingerprinting
+// disabled) every non-member hash resolves to some slot's value, so the
+// rate is 1.
+func FalsePositiveRate(bits uint8) float64 {
+	if bits == 0 {
+		return 1
+	}
+	return math.Pow(2, -float64(bits))
+}
@@ -0,0 +1,110 @@
+package mph
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Hasher computes a 64-bit hash of key. Implementations should be
+// deterministic for identical key bytes and reasonably uniform; mph relies
+// on avalanche behavior to avoid bucket pileups during construction.
+type Hasher interface {
+	Sum64(key []byte) uint64
+}
+
+// xxhasher adapts github.com/cespare/xxhash/v2 to Hasher. It's the default
+// used by NewBytes and QueryBytes when no Hasher is given. New hashes with
+// xxhash directly, and NewUint64 takes already-hashed keys.
+type xxhasher struct{}
+
+func (xxhasher) Sum64(key []byte) uint64 { return xxhash.Sum64(key) }
+
+// BuilderOptions configures how NewBytes hashes keys into the uint64 space
+// NewUint64 builds from.
+type BuilderOptions struct {
+	// Hasher hashes each key. Defaults to xxhash.
+	Hasher Hasher
+	// Seed is mixed into every hash (hash ^ Seed) so a failed build can be
+	// retried over a different hash space without swapping the Hasher.
+	Seed uint64
+}
+
+// Option configures a BuilderOptions.
+type Option func(*BuilderOptions)
+
+// WithHasher overrides the Hasher NewBytes uses to hash keys.
+func WithHasher(h Hasher) Option {
+	return func(o *BuilderOptions) { o.Hasher = h }
+}
+
+// WithSeed overrides the seed NewBytes mixes into every hash.
+func WithSeed(seed uint64) Option {
+	return func(o *BuilderOptions) { o.Seed = seed }
+}
+
+// maxSeedRetries bounds the rebuild-with-a-different-seed loop NewBytes
+// falls back to when a hash space leaves some bucket with no valid seed,
+// rather than surfacing ErrCouldNotBuildTable on the first attempt.
+const maxSeedRetries = 8
+
+// NewBytes builds a Table over raw byte keys, hashing each with opts'
+// Hasher (xxhash by default) XORed with opts' Seed. If construction fails
+// because some bucket has no valid seed, NewBytes perturbs the hash space
+// with a different Seed and retries, up to maxSeedRetries times, before
+// giving up.
+func NewBytes(keys [][]byte, opts ...Option) (*Table, error) {
+	o := BuilderOptions{Hasher: xxhasher{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Hasher == nil {
+		o.Hasher = xxhasher{}
+	}
+
+	seed := o.Seed
+	var lastErr error
+	for attempt := 0; attempt <= maxSeedRetries; attempt++ {
+		hKeys := make([]uint64, len(keys))
+		for i, k := range keys {
+			hKeys[i] = o.Hasher.Sum64(k) ^ seed
+		}
+
+		t, err := NewUint64(hKeys)
+		if err == nil {
+			t.Seed = seed
+			t.HasherName = fmt.Sprintf("%T", o.Hasher)
+			return t, nil
+		}
+		if !errors.Is(err, ErrCouldNotBuildTable) {
+			return nil, err
+		}
+		lastErr = err
+		seed++
+	}
+	return nil, lastErr
+}
+
+// NewFunc builds a Table over arbitrary keys using hash to map each one to
+// a uint64. Unlike NewBytes, it doesn't retry with a perturbed hash space
+// on failure, since hash is caller-defined and may not accept a seed.
+func NewFunc[T any](keys []T, hash func(T) uint64) (*Table, error) {
+	hKeys := make([]uint64, len(keys))
+	for i, k := range keys {
+		hKeys[i] = hash(k)
+	}
+	return NewUint64(hKeys)
+}
+
+// QueryBytes hashes key the same way NewBytes did (the same Hasher, mixed
+// with t.Seed) and returns Query's result for it. Pass the Hasher that
+// built t — after loading t from disk, that means reconstructing the same
+// Hasher implementation named by t.HasherName, since Go can't deserialize
+// one automatically. A nil h defaults to xxhash, matching NewBytes' default.
+func (t *Table) QueryBytes(key []byte, h Hasher) int32 {
+	if h == nil {
+		h = xxhasher{}
+	}
+	return t.Query(h.Sum64(key) ^ t.Seed)
+}
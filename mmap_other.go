@@ -0,0 +1,26 @@
+//go:build !unix
+
+package mph
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile falls back to reading the whole file into memory on platforms
+// without a Unix-style mmap syscall (e.g. plan9, js/wasm). Close is a no-op
+// for tables loaded this way.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func munmap(b []byte) error {
+	return nil
+}
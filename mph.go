@@ -3,8 +3,6 @@ package mph
 
 import (
 	"errors"
-	"fmt"
-	"sort"
 
 	"github.com/cespare/xxhash/v2"
 )
@@ -18,10 +16,33 @@ var (
 // - Seeds:  route to value, this was part of a multi key bucket input
 //   - high bit set = singleton value, there is no contention for allocation
 //   - high bit clear = multi-key bucket, the seed is the displacement of the initial value retrieved
+//
+// A Table can be serialized with MarshalBinary/WriteTo and loaded back with
+// UnmarshalBinary or OpenFile; see binary.go for the on-disk layout.
 type Table struct {
 	Values []int32
 	Seeds  []uint32
 	Mask   uint64
+
+	// Fingerprints holds FPBits-wide fingerprints of each slot's original
+	// hash, used by Query to reject non-member hashes. Nil when FPBits is
+	// 0 (the default), matching the original behavior. See Builder's
+	// FingerprintBits and FalsePositiveRate.
+	Fingerprints []uint16
+	FPBits       uint8
+
+	// Seed and HasherName record how NewBytes hashed the original keys
+	// into Values/Seeds, so a Table loaded from disk can be queried with
+	// QueryBytes by supplying the same Hasher again. HasherName is
+	// informational (the Go type name of the Hasher used, via %T) since a
+	// Hasher implementation itself can't be deserialized; both are zero for
+	// tables built with New, NewUint64 or NewFunc.
+	Seed       uint64
+	HasherName string
+
+	// raw is the mmap'd backing memory when the table was returned by
+	// OpenFile, and nil otherwise. Close unmaps it.
+	raw []byte
 }
 
 const (
@@ -29,11 +50,6 @@ const (
 	payloadMask  = ^singletonBit
 )
 
-type entry struct {
-	idx  int32
-	hash uint64
-}
-
 func New(keys []string) (*Table, error) {
 	hKeys := make([]uint64, len(keys))
 	for i, k := range keys {
@@ -43,115 +59,11 @@ func New(keys []string) (*Table, error) {
 	return NewUint64(hKeys)
 }
 
+// NewUint64 builds a Table sequentially. It is a thin wrapper around
+// Builder{Workers: 1}.Build; use a Builder directly to search bucket seeds
+// concurrently for large key sets.
 func NewUint64(keys []uint64) (*Table, error) {
-	if len(keys) == 0 {
-		return &Table{}, nil
-	}
-
-	if len(keys) > (1 << 31) {
-		return nil, fmt.Errorf("%w: too many keys, 2^31 is the max", ErrCouldNotBuildTable)
-	}
-
-	// early dedupe/error on duplicate hash
-	tmp := append([]uint64(nil), keys...)
-	sort.Slice(tmp, func(i, j int) bool { return tmp[i] < tmp[j] })
-	for i := 1; i < len(tmp); i++ {
-		if tmp[i] == tmp[i-1] {
-			return nil, fmt.Errorf("%w: duplicate 64-bit hash %d", ErrCouldNotBuildTable, tmp[i])
-		}
-	}
-
-	size := uint64(nextPower2(len(keys)))
-	mask := size - 1
-	h := make([][]entry, int(size))
-	values := make([]int32, int(size))
-	seeds := make([]uint32, int(size))
-
-	for idx, k := range keys {
-		hash := k
-		// extract the lower log2 size bits
-		i := int(hash & mask)
-		// 0 means empty, that is why idx+1 is used
-		h[i] = append(h[i], entry{int32(idx) + 1, hash})
-	}
-
-	// pick the biggest buckets first - handle the most difficult before moving on to the simpler
-	sort.Slice(h, func(i, j int) bool { return len(h[i]) > len(h[j]) })
-
-	var hidx int
-	for hidx = 0; hidx < len(h) && len(h[hidx]) > 1; hidx++ {
-		subkeys := h[hidx]
-
-		var seed uint64
-		entries := make(map[uint64]int32, len(subkeys))
-
-	newseed:
-		for {
-			seed++
-			// we use the first bit for singletons
-			if seed >= (1 << 31) {
-				return nil, fmt.Errorf("%w: no seed < 2^31", ErrCouldNotBuildTable)
-			}
-
-			for _, k := range subkeys {
-				i := xorshiftMult64(k.hash+seed) & mask
-
-				// check if slot i is free in both temporary (entries) and permanent (values)
-				if entries[i] == 0 && values[int(i)] == 0 {
-					entries[i] = k.idx
-					continue
-				}
-
-				// hash collision, clear scratch claims and try next seed
-				for k := range entries {
-					delete(entries, k)
-				}
-				continue newseed
-			}
-
-			break
-		}
-
-		// commit placements: mark these slots as permanently taken.
-		for k, v := range entries {
-			values[int(k)] = v
-		}
-
-		// store this seed for the entire bucket
-		i := subkeys[0].hash & mask
-		seeds[int(i)] = uint32(seed) // fits in 31 bits
-	}
-
-	// these are all singletons - entries with no conflicts in their respective buckets
-	// collect free values
-	free := make([]int, 0, int(size))
-	for i := range values {
-		if values[i] == 0 {
-			free = append(free, i)
-		} else {
-			// stored idx+1 before
-			values[i]--
-		}
-	}
-
-	for ; hidx < len(h) && len(h[int(hidx)]) > 0; hidx++ {
-		k := h[int(hidx)][0]
-		i := k.hash & mask
-
-		dst := free[0]
-		free = free[1:]
-
-		values[dst] = k.idx - 1
-
-		// high bit = 1 (marked as singleton, no seed logic required to get to value), payload = dst.
-		seeds[int(i)] = singletonBit | uint32(dst)
-	}
-
-	return &Table{
-		Values: values,
-		Seeds:  seeds,
-		Mask:   mask,
-	}, nil
+	return Builder{Workers: 1}.Build(keys)
 }
 
 func (t *Table) Query(hash uint64) int32 {
@@ -162,18 +74,25 @@ func (t *Table) Query(hash uint64) int32 {
 	i := int(hash & t.Mask)
 	s := t.Seeds[i]
 
+	var dst int
 	// `if seed < 0` is bugged
 	// there are edge cases where the value returned by doing `[-seed-1]` will return an index that is out of bounds
 	if s&singletonBit != 0 {
 		// singleton case, this is easy, just get everything except for the highest bit
-		dst := int(s & payloadMask)
-		return t.Values[dst]
+		dst = int(s & payloadMask)
+	} else {
+		// multi key case recompute displaced slot with xorshiftMult64(hash+seed) & mask
+		seed := uint64(s & payloadMask)
+		dst = int(xorshiftMult64(hash+seed) & t.Mask)
+	}
+
+	if t.FPBits > 0 && fingerprint(hash, t.FPBits) != t.Fingerprints[dst] {
+		// hash resolved to a real slot, but it was never a member of this
+		// table: reject instead of returning an arbitrary index.
+		return -1
 	}
 
-	// multi key case recompute displaced slot with xorshiftMult64(hash+seed) & mask
-	seed := uint64(s & payloadMask)
-	j := xorshiftMult64(hash+seed) & t.Mask
-	return t.Values[int(j)]
+	return t.Values[dst]
 }
 
 func xorshiftMult64(x uint64) uint64 {
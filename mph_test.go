@@ -2,11 +2,14 @@ package mph
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/cespare/xxhash/v2"
 )
@@ -126,6 +129,353 @@ func TestMPH_RandomSubsets_U64(t *testing.T) {
 	}
 }
 
+func TestMPH_NewBytesQueryBytes(t *testing.T) {
+	base := []string{"foo", "bar", "baz", "qux", "zot", "frob", "zork", "zeek"}
+	keys := make([][]byte, len(base))
+	for i, s := range base {
+		keys[i] = []byte(s)
+	}
+
+	tab, err := NewBytes(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range keys {
+		if got := tab.QueryBytes(k, nil); got != int32(i) {
+			t.Errorf("QueryBytes(%q)=%v, want %v", k, got, i)
+		}
+	}
+}
+
+func TestMPH_NewFunc(t *testing.T) {
+	type item struct {
+		id uint64
+	}
+	items := make([]item, 8)
+	for i := range items {
+		items[i] = item{id: uint64(i) * 7919}
+	}
+
+	tab, err := NewFunc(items, func(it item) uint64 { return it.id })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, it := range items {
+		if got := tab.Query(it.id); got != int32(i) {
+			t.Errorf("Query(%v)=%v, want %v", it.id, got, i)
+		}
+	}
+}
+
+func TestMPH_FingerprintFalsePositiveRate(t *testing.T) {
+	const bits = 8
+	const nKeys = 4000
+	const nProbes = 200000
+
+	keys := make([]uint64, nKeys)
+	member := make(map[uint64]bool, nKeys)
+	for i := range keys {
+		k := xxhash.Sum64String(fmt.Sprintf("fp-member-%d", i))
+		keys[i] = k
+		member[k] = true
+	}
+
+	tab, err := Builder{FingerprintBits: bits}.Build(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var falsePositives int
+	rng := rand.New(rand.NewSource(1))
+	probed := 0
+	for probed < nProbes {
+		h := rng.Uint64()
+		if member[h] {
+			continue
+		}
+		probed++
+		if tab.Query(h) >= 0 {
+			falsePositives++
+		}
+	}
+
+	got := float64(falsePositives) / float64(nProbes)
+	want := FalsePositiveRate(bits)
+	// Allow generous slack: this is a statistical check, not an exact one.
+	if got > want*4 {
+		t.Fatalf("observed false positive rate %.5f far exceeds FalsePositiveRate(%d)=%.5f", got, bits, want)
+	}
+}
+
+func TestMPH_BuilderWorkersDeterministic(t *testing.T) {
+	keys := make([]uint64, 20000)
+	for i := range keys {
+		keys[i] = xxhash.Sum64String(fmt.Sprintf("worker-det-key-%d", i))
+	}
+
+	want, err := Builder{Workers: 8}.Build(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for run := 0; run < 10; run++ {
+		got, err := Builder{Workers: 8}.Build(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalInt32(got.Values, want.Values) || !equalUint32(got.Seeds, want.Seeds) || got.Mask != want.Mask {
+			t.Fatalf("run %d: Builder{Workers: 8}.Build produced a different table than the first run", run)
+		}
+	}
+
+	// The concurrent build must also agree with the sequential one, since
+	// both process buckets in the same stable order.
+	sequential, err := Builder{Workers: 1}.Build(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInt32(want.Values, sequential.Values) || !equalUint32(want.Seeds, sequential.Seeds) {
+		t.Fatal("Builder{Workers: 8}.Build disagrees with Builder{Workers: 1}.Build")
+	}
+}
+
+func equalInt32(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalUint32(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMPH_BuilderWorkersFailureUnblocksWaiters(t *testing.T) {
+	keys := loadKeysU64(t)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Builder{Workers: 4, MaxSeed: 2}.Build(keys)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrCouldNotBuildTable) {
+			t.Fatalf("Build error = %v, want ErrCouldNotBuildTable", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Build with an unreachable MaxSeed hung instead of returning ErrCouldNotBuildTable")
+	}
+}
+
+func TestMPH_Sharded(t *testing.T) {
+	keys := make([]uint64, 5000)
+	for i := range keys {
+		keys[i] = xxhash.Sum64String(fmt.Sprintf("sharded-key-%d", i))
+	}
+
+	// targetShardSize well below len(keys) forces more than one shard, so
+	// the boundary between shards is actually exercised.
+	st, err := NewSharded(keys, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int32]bool, len(keys))
+	for _, k := range keys {
+		v := st.Query(k)
+		if v < 0 || v >= int32(len(keys)) {
+			t.Fatalf("Query(%v)=%v, want index in [0, %d)", k, v, len(keys))
+		}
+		if seen[v] {
+			t.Fatalf("Query(%v)=%v, duplicate global index", k, v)
+		}
+		seen[v] = true
+	}
+}
+
+func TestMPH_ShardedBinaryRoundTrip(t *testing.T) {
+	keys := make([]uint64, 5000)
+	for i := range keys {
+		keys[i] = xxhash.Sum64String(fmt.Sprintf("sharded-rt-key-%d", i))
+	}
+
+	st, err := NewSharded(keys, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := st.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got ShardedTable
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		if v, want := got.Query(k), st.Query(k); v != want {
+			t.Errorf("Query(%v)=%v, want %v", k, v, want)
+		}
+	}
+}
+
+func TestMPH_OpenShardedFileRoundTrip(t *testing.T) {
+	keys := make([]uint64, 5000)
+	for i := range keys {
+		keys[i] = xxhash.Sum64String(fmt.Sprintf("open-sharded-key-%d", i))
+	}
+
+	st, err := NewSharded(keys, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sharded.mph")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.WriteTo(f); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := OpenShardedFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+
+	for _, k := range keys {
+		if v, want := got.Query(k), st.Query(k); v != want {
+			t.Errorf("Query(%v)=%v, want %v", k, v, want)
+		}
+	}
+}
+
+func TestMPH_ShardedBinaryCorruption(t *testing.T) {
+	keys := make([]uint64, 5000)
+	for i := range keys {
+		keys[i] = xxhash.Sum64String(fmt.Sprintf("sharded-corrupt-key-%d", i))
+	}
+
+	st, err := NewSharded(keys, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := st.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a byte of the shard-count header field; decoding must fail
+	// rather than hand back a ShardedTable whose shards/shift disagree.
+	data[8] ^= 0xff
+	var corrupt ShardedTable
+	if err := corrupt.UnmarshalBinary(data); err == nil {
+		t.Fatalf("UnmarshalBinary with corrupted shard count: got nil error, want an error")
+	}
+}
+
+func TestMPH_OpenFileRoundTrip(t *testing.T) {
+	keys := loadKeysU64(t)
+
+	tab, err := NewUint64(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "table.mph")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tab.WriteTo(f); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+
+	for i, k := range keys {
+		if v := got.Query(k); v != int32(i) {
+			t.Errorf("Query(%v)=%v, want %v", k, v, i)
+		}
+	}
+}
+
+func TestMPH_BinaryRoundTrip(t *testing.T) {
+	keys := loadKeysU64(t)
+
+	tab, err := NewUint64(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := tab.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Table
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range keys {
+		if v := got.Query(k); v != int32(i) {
+			t.Errorf("Query(%v)=%v, want %v", k, v, i)
+		}
+	}
+}
+
+func TestMPH_BinaryCorruption(t *testing.T) {
+	keys := loadKeysU64(t)
+
+	tab, err := NewUint64(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tab.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a byte of Mask, a fixed header field outside the old body-only
+	// checksum; decoding must fail rather than hand back a Table whose
+	// Mask disagrees with len(Seeds).
+	data[16] ^= 0xff
+	var corrupt Table
+	if err := corrupt.UnmarshalBinary(data); !errors.Is(err, ErrChecksumFailed) {
+		t.Fatalf("UnmarshalBinary with corrupted Mask byte: got %v, want ErrChecksumFailed", err)
+	}
+}
+
 var sinkI32 int32
 
 func BenchmarkMPH_U64(b *testing.B) {
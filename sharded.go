@@ -0,0 +1,119 @@
+package mph
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ShardedTable partitions keys across N independent Tables, chosen by the
+// top bits of each key's hash, so each shard is built from only a fraction
+// of the keys. Splitting into many smaller tables also makes each shard's
+// seed search far likelier to succeed with small seeds, the same trick
+// compact on-disk hash indexes use to bound displacement search cost. The
+// combined total across all shards is capped at 2^31-1 keys, since Query
+// reports the global index as an int32, so a ShardedTable holds no more
+// keys than a single Table.
+type ShardedTable struct {
+	shards  []*Table
+	offsets []int32 // global base index added to each shard's Query result
+	shift   uint    // bits to shift a hash right by to get its shard index
+
+	// raw is the mmap'd backing memory when the table was returned by
+	// OpenShardedFile, and nil otherwise. Close unmaps it.
+	raw []byte
+}
+
+// NewSharded partitions keys into roughly targetShardSize-sized shards
+// (rounded up to a power of two shard count) and builds each shard
+// independently and concurrently.
+func NewSharded(keys []uint64, targetShardSize int) (*ShardedTable, error) {
+	if targetShardSize <= 0 {
+		return nil, fmt.Errorf("%w: targetShardSize must be positive", ErrCouldNotBuildTable)
+	}
+	if len(keys) > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: too many keys, 2^31-1 is the max a ShardedTable's int32 global index can address", ErrCouldNotBuildTable)
+	}
+
+	nShards := 1
+	if len(keys) > 0 {
+		nShards = nextPower2(len(keys) / targetShardSize)
+		if nShards < 1 {
+			nShards = 1
+		}
+	}
+	shift := shardShift(nShards)
+
+	buckets := make([][]uint64, nShards)
+	for _, k := range keys {
+		s := shardIndex(k, shift, nShards)
+		buckets[s] = append(buckets[s], k)
+	}
+
+	shards := make([]*Table, nShards)
+	var g errgroup.Group
+	for s := range buckets {
+		s := s
+		g.Go(func() error {
+			t, err := NewUint64(buckets[s])
+			if err != nil {
+				return fmt.Errorf("mph: shard %d: %w", s, err)
+			}
+			shards[s] = t
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	offsets := make([]int32, nShards)
+	var base int32
+	for s, bucket := range buckets {
+		offsets[s] = base
+		base += int32(len(bucket))
+	}
+
+	return &ShardedTable{shards: shards, offsets: offsets, shift: shift}, nil
+}
+
+// shardShift returns the right-shift that isolates the top bits of a hash
+// needed to pick among nShards shards.
+func shardShift(nShards int) uint {
+	if nShards <= 1 {
+		return 64
+	}
+	return 64 - uint(bits.Len(uint(nShards-1)))
+}
+
+func shardIndex(hash uint64, shift uint, nShards int) int {
+	if nShards <= 1 {
+		return 0
+	}
+	return int(hash >> shift)
+}
+
+// Query returns the globally unique index of hash in [0, N), where N is the
+// total number of keys the table was built from, or -1 if hash's shard
+// reports no match.
+func (st *ShardedTable) Query(hash uint64) int32 {
+	s := shardIndex(hash, st.shift, len(st.shards))
+	v := st.shards[s].Query(hash)
+	if v < 0 {
+		return -1
+	}
+	return st.offsets[s] + v
+}
+
+// Close unmaps the memory backing st if it was returned by
+// OpenShardedFile. It is a no-op for tables built directly with NewSharded.
+func (st *ShardedTable) Close() error {
+	if st.raw == nil {
+		return nil
+	}
+	err := munmap(st.raw)
+	st.raw = nil
+	return err
+}
@@ -0,0 +1,169 @@
+package mph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// On-disk format for a ShardedTable: a small header (magic, version, shard
+// count, shift, checksum) followed by one directory entry per shard. Each
+// entry is the shard's base offset, then its Table encoded with the exact
+// layout from binary.go, length-prefixed and padded to an 8-byte boundary
+// so OpenShardedFile can mmap the whole file once and hand each shard a
+// zero-copy view into it. Like Table's record, the checksum covers the
+// whole header (with the checksum field zeroed) plus body, so a corrupt
+// shard count or shift is caught rather than surfacing as an out-of-range
+// shard lookup.
+const (
+	shardedMagic      = "MPHS"
+	shardedVersion    = 1
+	shardedHeaderSize = 24
+)
+
+// MarshalBinary encodes st using the layout documented on WriteTo.
+func (st *ShardedTable) MarshalBinary() ([]byte, error) {
+	var buf []byte
+	w := &sliceWriter{buf: &buf}
+	if _, err := st.WriteTo(w); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// WriteTo writes st in the format described above.
+func (st *ShardedTable) WriteTo(w io.Writer) (int64, error) {
+	var body []byte
+	for i, t := range st.shards {
+		blob, err := t.MarshalBinary()
+		if err != nil {
+			return 0, fmt.Errorf("mph: shard %d: %w", i, err)
+		}
+		body = appendUint64(body, uint64(st.offsets[i]))
+		body = appendUint64(body, uint64(len(blob)))
+		body = append(body, blob...)
+		body = append(body, padBytes(len(blob))...)
+	}
+
+	var hdr [shardedHeaderSize]byte
+	copy(hdr[0:4], shardedMagic)
+	binary.LittleEndian.PutUint32(hdr[4:8], shardedVersion)
+	binary.LittleEndian.PutUint32(hdr[8:12], uint32(len(st.shards)))
+	binary.LittleEndian.PutUint32(hdr[12:16], uint32(st.shift))
+	// hdr[16:20] (checksum) is filled in below, once the rest of the header
+	// it covers is in place.
+	// hdr[20:24] reserved, left zero.
+	binary.LittleEndian.PutUint32(hdr[16:20], checksumRecord(hdr[:], body))
+
+	n1, err := w.Write(hdr[:])
+	if err != nil {
+		return int64(n1), err
+	}
+	n2, err := w.Write(body)
+	return int64(n1 + n2), err
+}
+
+// UnmarshalBinary decodes a sharded table previously produced by
+// MarshalBinary or WriteTo. The decoded shards are copies, independent of
+// data.
+func (st *ShardedTable) UnmarshalBinary(data []byte) error {
+	decoded, err := newShardedTableFromBytes(data, false)
+	if err != nil {
+		return err
+	}
+	*st = *decoded
+	return nil
+}
+
+// OpenShardedFile mmaps the sharded table stored at path and returns a
+// ShardedTable whose shards are views directly into the mapped bytes. Call
+// Close when done to unmap.
+func OpenShardedFile(path string) (*ShardedTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := mmapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := newShardedTableFromBytes(raw, true)
+	if err != nil {
+		munmap(raw)
+		return nil, err
+	}
+	st.raw = raw
+	return st, nil
+}
+
+func newShardedTableFromBytes(data []byte, zeroCopy bool) (*ShardedTable, error) {
+	if len(data) < shardedHeaderSize {
+		return nil, fmt.Errorf("%w: truncated header", ErrInvalidFormat)
+	}
+	if string(data[0:4]) != shardedMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidFormat)
+	}
+	if v := binary.LittleEndian.Uint32(data[4:8]); v != shardedVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidFormat, v)
+	}
+	shardCount := binary.LittleEndian.Uint32(data[8:12])
+	shift := binary.LittleEndian.Uint32(data[12:16])
+	wantChecksum := binary.LittleEndian.Uint32(data[16:20])
+
+	body := data[shardedHeaderSize:]
+	var hdr [shardedHeaderSize]byte
+	copy(hdr[:], data[:shardedHeaderSize])
+	binary.LittleEndian.PutUint32(hdr[16:20], 0)
+	if checksumRecord(hdr[:], body) != wantChecksum {
+		return nil, ErrChecksumFailed
+	}
+	if shardCount == 0 {
+		return nil, fmt.Errorf("%w: shard count must be positive", ErrInvalidFormat)
+	}
+	if shift != uint32(shardShift(int(shardCount))) {
+		return nil, fmt.Errorf("%w: shift inconsistent with shard count", ErrInvalidFormat)
+	}
+
+	shards := make([]*Table, shardCount)
+	offsets := make([]int32, shardCount)
+
+	off := 0
+	for i := range shards {
+		if off+16 > len(body) {
+			return nil, fmt.Errorf("%w: truncated shard %d directory entry", ErrInvalidFormat, i)
+		}
+		offsets[i] = int32(binary.LittleEndian.Uint64(body[off : off+8]))
+		off += 8
+		blobLen := int(binary.LittleEndian.Uint64(body[off : off+8]))
+		off += 8
+
+		blob := body[off : off+blobLen]
+		off += blobLen + len(padBytes(blobLen))
+
+		t, err := newTableFromBytes(blob, zeroCopy)
+		if err != nil {
+			return nil, fmt.Errorf("mph: shard %d: %w", i, err)
+		}
+		shards[i] = t
+	}
+
+	var total int64
+	for _, t := range shards {
+		total += int64(len(t.Values))
+	}
+	if total > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: total key count overflows the int32 global index", ErrInvalidFormat)
+	}
+
+	return &ShardedTable{shards: shards, offsets: offsets, shift: uint(shift)}, nil
+}